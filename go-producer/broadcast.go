@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultMaxMessageBytes bounds both the upgrader's connection buffers and
+// the largest outgoing frame sendEntry will forward, so a single oversized
+// batched entry can't blow past the buffers gorilla/websocket allocated for
+// this connection.
+const defaultMaxMessageBytes = 1 << 20 // 1MB
+
+const (
+	defaultReadDeadline  = 60 * time.Second
+	defaultWriteDeadline = 10 * time.Second
+)
+
+// BroadcastServer tails the telemetry Redis streams and fans each entry out
+// to WebSocket subscribers of /ws/location/{session} and /ws/cardata/{session}.
+type BroadcastServer struct {
+	redisClient     *redis.Client
+	maxMessageBytes int
+	readDeadline    time.Duration
+	writeDeadline   time.Duration
+	upgrader        websocket.Upgrader
+}
+
+// NewBroadcastServer builds a BroadcastServer. maxMessageBytes of 0 selects
+// defaultMaxMessageBytes.
+func NewBroadcastServer(redisClient *redis.Client, maxMessageBytes int) *BroadcastServer {
+	if maxMessageBytes <= 0 {
+		maxMessageBytes = defaultMaxMessageBytes
+	}
+
+	return &BroadcastServer{
+		redisClient:     redisClient,
+		maxMessageBytes: maxMessageBytes,
+		readDeadline:    defaultReadDeadline,
+		writeDeadline:   defaultWriteDeadline,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  maxMessageBytes,
+			WriteBufferSize: maxMessageBytes,
+			CheckOrigin:     func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// Routes registers the replay endpoints on mux.
+func (b *BroadcastServer) Routes(mux *http.ServeMux) {
+	mux.HandleFunc("/ws/location/", b.handleStream("telemetry:location:", streamKindLocation))
+	mux.HandleFunc("/ws/cardata/", b.handleStream("telemetry:cardata:", streamKindCarData))
+}
+
+// streamKind tells sendEntry which struct to decode a stream entry into when
+// a subscriber negotiates a non-JSON response format.
+type streamKind int
+
+const (
+	streamKindLocation streamKind = iota
+	streamKindCarData
+)
+
+// responseFormat picks the outgoing wire format from the request's Accept
+// header; everything but "application/x-protobuf" falls back to JSON.
+func responseFormat(r *http.Request) PayloadFormat {
+	if r.Header.Get("Accept") == "application/x-protobuf" {
+		return PayloadFormatProtobuf
+	}
+	return PayloadFormatJSON
+}
+
+// handleStream returns a handler that tails streamPrefix+{session} and
+// pushes each entry to the subscriber, re-encoded per the Accept header.
+func (b *BroadcastServer) handleStream(streamPrefix string, kind streamKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, streamPathPrefix(streamPrefix)), "/")
+		if session == "" {
+			http.Error(w, "missing session in path", http.StatusBadRequest)
+			return
+		}
+		streamKey := streamPrefix + session
+
+		driverFilter := 0
+		if raw := r.URL.Query().Get("driver_number"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, "invalid driver_number", http.StatusBadRequest)
+				return
+			}
+			driverFilter = n
+		}
+
+		cursor, err := b.startCursor(r.Context(), streamKey, r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := responseFormat(r)
+
+		conn, err := b.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("broadcast: upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		b.tail(r.Context(), conn, streamKey, cursor, driverFilter, kind, format)
+	}
+}
+
+// streamPathPrefix turns "telemetry:location:" into "/ws/location/".
+func streamPathPrefix(streamPrefix string) string {
+	parts := strings.Split(strings.TrimSuffix(streamPrefix, ":"), ":")
+	return "/ws/" + parts[len(parts)-1] + "/"
+}
+
+// startCursor resolves the replay-from cursor: "$" (the default) tails only
+// new entries, while a unix-ms or RFC3339 "from" value seeks the stream by ID
+// so the subscriber first drains history before switching to a live tail.
+func (b *BroadcastServer) startCursor(ctx context.Context, streamKey, from string) (string, error) {
+	if from == "" {
+		return "$", nil
+	}
+
+	if ms, err := strconv.ParseInt(from, 10, 64); err == nil {
+		return strconv.FormatInt(ms, 10) + "-0", nil
+	}
+
+	t, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(t.UnixMilli(), 10) + "-0", nil
+}
+
+// tail drains history from cursor (if it isn't "$") and then blocks on
+// XREAD BLOCK, forwarding each matching entry until the connection closes.
+func (b *BroadcastServer) tail(ctx context.Context, conn *websocket.Conn, streamKey, cursor string, driverFilter int, kind streamKind, format PayloadFormat) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go b.discardReads(conn, cancel)
+
+	if cursor != "$" {
+		history, err := b.redisClient.XRange(ctx, streamKey, cursor, "+").Result()
+		if err != nil {
+			log.Printf("broadcast: XRANGE %s failed: %v", streamKey, err)
+			return
+		}
+		for _, msg := range history {
+			if !b.sendEntry(conn, msg, driverFilter, kind, format) {
+				return
+			}
+			cursor = msg.ID
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		streams, err := b.redisClient.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{streamKey, cursor},
+			Block:   b.readDeadline,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("broadcast: XREAD %s failed: %v", streamKey, err)
+			return
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if !b.sendEntry(conn, msg, driverFilter, kind, format) {
+					return
+				}
+				cursor = msg.ID
+			}
+		}
+	}
+}
+
+// discardReads pumps conn's read side so the client's pings/pongs/close
+// frames are handled by gorilla's control-frame dispatch and readDeadline
+// actually has something to time out; the content of ordinary data frames is
+// discarded since this is a publish-only stream. Calls cancel as soon as the
+// read fails, which tells tail's XREAD loop to stop promptly instead of
+// waiting to notice on its next WriteMessage.
+func (b *BroadcastServer) discardReads(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+	for {
+		conn.SetReadDeadline(time.Now().Add(b.readDeadline))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// sendEntry writes a single stream entry to conn, applying the
+// driver_number filter and decoding the entry's stored payload and
+// re-encoding it into format (even when it was already stored that way).
+// Returns false if the connection should be closed.
+func (b *BroadcastServer) sendEntry(conn *websocket.Conn, msg redis.XMessage, driverFilter int, kind streamKind, format PayloadFormat) bool {
+	if driverFilter != 0 {
+		if raw, ok := msg.Values["driver_number"]; ok {
+			if n, err := strconv.Atoi(toString(raw)); err == nil && n != driverFilter {
+				return true
+			}
+		}
+	}
+
+	frame, messageType, err := b.encodeFrame(msg, kind, format)
+	if err != nil {
+		log.Printf("broadcast: encode frame failed: %v", err)
+		return true
+	}
+	if len(frame) > b.maxMessageBytes {
+		log.Printf("broadcast: dropping frame of %d bytes, exceeds MaxMessageBytes=%d", len(frame), b.maxMessageBytes)
+		return true
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(b.writeDeadline))
+	if err := conn.WriteMessage(messageType, frame); err != nil {
+		log.Printf("broadcast: write failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// encodeFrame decodes the stream entry's stored payload (per the "format"
+// field it was pushed with) and re-encodes it into the subscriber's
+// negotiated format.
+func (b *BroadcastServer) encodeFrame(msg redis.XMessage, kind streamKind, format PayloadFormat) ([]byte, int, error) {
+	storedFormat := parsePayloadFormat(toString(msg.Values["format"]))
+	data := []byte(toString(msg.Values["data"]))
+
+	switch kind {
+	case streamKindLocation:
+		loc, err := decodeLocationPoint(storedFormat, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		encoded, err := encodeLocationPoint(format, loc)
+		return encoded, messageTypeFor(format), err
+	default:
+		cd, err := decodeCarData(storedFormat, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		encoded, err := encodeCarData(format, cd)
+		return encoded, messageTypeFor(format), err
+	}
+}
+
+func messageTypeFor(format PayloadFormat) int {
+	if format == PayloadFormatJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
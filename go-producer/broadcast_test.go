@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStreamPathPrefix(t *testing.T) {
+	tests := []struct {
+		streamPrefix string
+		expected     string
+	}{
+		{"telemetry:location:", "/ws/location/"},
+		{"telemetry:cardata:", "/ws/cardata/"},
+	}
+
+	for _, tt := range tests {
+		if got := streamPathPrefix(tt.streamPrefix); got != tt.expected {
+			t.Errorf("streamPathPrefix(%q) = %q, want %q", tt.streamPrefix, got, tt.expected)
+		}
+	}
+}
+
+func TestStartCursor(t *testing.T) {
+	b := NewBroadcastServer(nil, 0)
+
+	tests := []struct {
+		name     string
+		from     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "empty defaults to live tail", from: "", expected: "$"},
+		{name: "unix millis", from: "1715520000000", expected: "1715520000000-0"},
+		{name: "RFC3339", from: "2024-05-12T14:00:00Z", expected: "1715522400000-0"},
+		{name: "invalid", from: "not-a-time", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.startCursor(context.Background(), "telemetry:location:9140", tt.from)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("startCursor(%q) expected error, got nil", tt.from)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("startCursor(%q) unexpected error: %v", tt.from, err)
+			}
+			if got != tt.expected {
+				t.Errorf("startCursor(%q) = %q, want %q", tt.from, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToString(t *testing.T) {
+	if got := toString("driver-44"); got != "driver-44" {
+		t.Errorf("toString(string) = %q, want %q", got, "driver-44")
+	}
+	if got := toString(44); got != "" {
+		t.Errorf("toString(non-string) = %q, want empty string", got)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PayloadFormat selects how a telemetry sample is serialized into the
+// stream's "data" field. The wire format is stamped alongside it (see
+// pushLocations/pushCarData) so any consumer can decode regardless of which
+// format produced the entry.
+type PayloadFormat string
+
+const (
+	PayloadFormatJSON         PayloadFormat = "json"
+	PayloadFormatProtobuf     PayloadFormat = "protobuf"
+	PayloadFormatProtobufZstd PayloadFormat = "protobuf+zstd"
+)
+
+// parsePayloadFormat maps a PAYLOAD_FORMAT env value to a PayloadFormat,
+// falling back to JSON for anything unrecognized.
+func parsePayloadFormat(raw string) PayloadFormat {
+	switch PayloadFormat(raw) {
+	case PayloadFormatProtobuf, PayloadFormatProtobufZstd:
+		return PayloadFormat(raw)
+	default:
+		return PayloadFormatJSON
+	}
+}
+
+// Field numbers from proto/telemetry.proto. protoc isn't available in this
+// build, so LocationPoint/CarData are (de)serialized by hand against the
+// wire format using protowire directly instead of generated bindings.
+const (
+	locationFieldSessionKey   = 1
+	locationFieldDriverNumber = 2
+	locationFieldDate         = 3
+	locationFieldX            = 4
+	locationFieldY            = 5
+	locationFieldZ            = 6
+
+	carDataFieldSessionKey   = 1
+	carDataFieldDriverNumber = 2
+	carDataFieldDate         = 3
+	carDataFieldSpeed        = 4
+	carDataFieldRPM          = 5
+	carDataFieldNGear        = 6
+	carDataFieldThrottle     = 7
+	carDataFieldBrake        = 8
+)
+
+func marshalLocationPoint(loc LocationPoint) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, locationFieldSessionKey, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(loc.SessionKey))
+	b = protowire.AppendTag(b, locationFieldDriverNumber, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(loc.DriverNumber))
+	b = protowire.AppendTag(b, locationFieldDate, protowire.BytesType)
+	b = protowire.AppendString(b, loc.Date)
+	b = protowire.AppendTag(b, locationFieldX, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, doubleBits(loc.X))
+	b = protowire.AppendTag(b, locationFieldY, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, doubleBits(loc.Y))
+	b = protowire.AppendTag(b, locationFieldZ, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, doubleBits(loc.Z))
+	return b
+}
+
+func unmarshalLocationPoint(data []byte) (LocationPoint, error) {
+	var loc LocationPoint
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return loc, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case locationFieldSessionKey:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.SessionKey = int(v)
+			data = data[n:]
+		case locationFieldDriverNumber:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.DriverNumber = int(v)
+			data = data[n:]
+		case locationFieldDate:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.Date = v
+			data = data[n:]
+		case locationFieldX:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.X = bitsDouble(v)
+			data = data[n:]
+		case locationFieldY:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.Y = bitsDouble(v)
+			data = data[n:]
+		case locationFieldZ:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			loc.Z = bitsDouble(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return loc, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return loc, nil
+}
+
+func marshalCarData(cd CarData) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, carDataFieldSessionKey, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.SessionKey))
+	b = protowire.AppendTag(b, carDataFieldDriverNumber, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.DriverNumber))
+	b = protowire.AppendTag(b, carDataFieldDate, protowire.BytesType)
+	b = protowire.AppendString(b, cd.Date)
+	b = protowire.AppendTag(b, carDataFieldSpeed, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.Speed))
+	b = protowire.AppendTag(b, carDataFieldRPM, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.RPM))
+	b = protowire.AppendTag(b, carDataFieldNGear, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.NGear))
+	b = protowire.AppendTag(b, carDataFieldThrottle, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.Throttle))
+	b = protowire.AppendTag(b, carDataFieldBrake, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(cd.Brake))
+	return b
+}
+
+func unmarshalCarData(data []byte) (CarData, error) {
+	var cd CarData
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return cd, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case carDataFieldSessionKey:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.SessionKey = int(v)
+			data = data[n:]
+		case carDataFieldDriverNumber:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.DriverNumber = int(v)
+			data = data[n:]
+		case carDataFieldDate:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.Date = v
+			data = data[n:]
+		case carDataFieldSpeed:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.Speed = int(v)
+			data = data[n:]
+		case carDataFieldRPM:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.RPM = int(v)
+			data = data[n:]
+		case carDataFieldNGear:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.NGear = int(v)
+			data = data[n:]
+		case carDataFieldThrottle:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.Throttle = int(v)
+			data = data[n:]
+		case carDataFieldBrake:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			cd.Brake = int(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return cd, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return cd, nil
+}
+
+// encodeLocationPoint serializes loc per format, compressing with zstd when
+// format is protobuf+zstd.
+func encodeLocationPoint(format PayloadFormat, loc LocationPoint) ([]byte, error) {
+	switch format {
+	case PayloadFormatProtobuf:
+		return marshalLocationPoint(loc), nil
+	case PayloadFormatProtobufZstd:
+		return zstdCompress(marshalLocationPoint(loc))
+	default:
+		return json.Marshal(loc)
+	}
+}
+
+// decodeLocationPoint is the inverse of encodeLocationPoint.
+func decodeLocationPoint(format PayloadFormat, data []byte) (LocationPoint, error) {
+	switch format {
+	case PayloadFormatProtobuf:
+		return unmarshalLocationPoint(data)
+	case PayloadFormatProtobufZstd:
+		raw, err := zstdDecompress(data)
+		if err != nil {
+			return LocationPoint{}, err
+		}
+		return unmarshalLocationPoint(raw)
+	default:
+		var loc LocationPoint
+		err := json.Unmarshal(data, &loc)
+		return loc, err
+	}
+}
+
+// encodeCarData serializes cd per format, compressing with zstd when format
+// is protobuf+zstd.
+func encodeCarData(format PayloadFormat, cd CarData) ([]byte, error) {
+	switch format {
+	case PayloadFormatProtobuf:
+		return marshalCarData(cd), nil
+	case PayloadFormatProtobufZstd:
+		return zstdCompress(marshalCarData(cd))
+	default:
+		return json.Marshal(cd)
+	}
+}
+
+// decodeCarData is the inverse of encodeCarData.
+func decodeCarData(format PayloadFormat, data []byte) (CarData, error) {
+	switch format {
+	case PayloadFormatProtobuf:
+		return unmarshalCarData(data)
+	case PayloadFormatProtobufZstd:
+		raw, err := zstdDecompress(data)
+		if err != nil {
+			return CarData{}, err
+		}
+		return unmarshalCarData(raw)
+	default:
+		var cd CarData
+		err := json.Unmarshal(data, &cd)
+		return cd, err
+	}
+}
+
+// zstdEncoder and zstdDecoder are built once and reused across calls; both
+// types are documented as safe for concurrent EncodeAll/DecodeAll use, but
+// fetchAndPush always compresses locations and car data from two goroutines
+// at once (times FETCH_CONCURRENCY interval workers), so the lazy-init
+// itself must be synchronized rather than a bare check-then-set.
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+)
+
+func zstdCompress(raw []byte) ([]byte, error) {
+	zstdEncoderOnce.Do(func() {
+		zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+	})
+	if zstdEncoderErr != nil {
+		return nil, fmt.Errorf("zstd: build encoder: %w", zstdEncoderErr)
+	}
+	return zstdEncoder.EncodeAll(raw, nil), nil
+}
+
+func zstdDecompress(compressed []byte) ([]byte, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil)
+	})
+	if zstdDecoderErr != nil {
+		return nil, fmt.Errorf("zstd: build decoder: %w", zstdDecoderErr)
+	}
+	return zstdDecoder.DecodeAll(compressed, nil)
+}
+
+func doubleBits(f float64) uint64 {
+	return math.Float64bits(f)
+}
+
+func bitsDouble(v uint64) float64 {
+	return math.Float64frombits(v)
+}
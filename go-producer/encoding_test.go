@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePayloadFormat(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected PayloadFormat
+	}{
+		{"json", PayloadFormatJSON},
+		{"protobuf", PayloadFormatProtobuf},
+		{"protobuf+zstd", PayloadFormatProtobufZstd},
+		{"", PayloadFormatJSON},
+		{"bogus", PayloadFormatJSON},
+	}
+
+	for _, tt := range tests {
+		if got := parsePayloadFormat(tt.raw); got != tt.expected {
+			t.Errorf("parsePayloadFormat(%q) = %q, want %q", tt.raw, got, tt.expected)
+		}
+	}
+}
+
+func TestLocationPointRoundTrip(t *testing.T) {
+	loc := LocationPoint{SessionKey: 9140, DriverNumber: 44, Date: "2024-05-12T14:00:00.123Z", X: 1234.567, Y: -8901.234, Z: 0.5}
+
+	for _, format := range []PayloadFormat{PayloadFormatJSON, PayloadFormatProtobuf, PayloadFormatProtobufZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			encoded, err := encodeLocationPoint(format, loc)
+			if err != nil {
+				t.Fatalf("encodeLocationPoint(%s) error = %v", format, err)
+			}
+
+			decoded, err := decodeLocationPoint(format, encoded)
+			if err != nil {
+				t.Fatalf("decodeLocationPoint(%s) error = %v", format, err)
+			}
+			if decoded != loc {
+				t.Errorf("decodeLocationPoint(%s) = %+v, want %+v", format, decoded, loc)
+			}
+		})
+	}
+}
+
+func TestCarDataRoundTrip(t *testing.T) {
+	cd := CarData{SessionKey: 9140, DriverNumber: 44, Date: "2024-05-12T14:00:00.123Z", Speed: 325, RPM: 12500, NGear: 8, Throttle: 100, Brake: 0}
+
+	for _, format := range []PayloadFormat{PayloadFormatJSON, PayloadFormatProtobuf, PayloadFormatProtobufZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			encoded, err := encodeCarData(format, cd)
+			if err != nil {
+				t.Fatalf("encodeCarData(%s) error = %v", format, err)
+			}
+
+			decoded, err := decodeCarData(format, encoded)
+			if err != nil {
+				t.Fatalf("decodeCarData(%s) error = %v", format, err)
+			}
+			if decoded != cd {
+				t.Errorf("decodeCarData(%s) = %+v, want %+v", format, decoded, cd)
+			}
+		})
+	}
+}
+
+// BenchmarkEncodeLocationPoint compares encoded byte size and throughput of
+// the JSON path against protobuf and protobuf+zstd.
+func BenchmarkEncodeLocationPoint(b *testing.B) {
+	loc := LocationPoint{SessionKey: 9140, DriverNumber: 44, Date: "2024-05-12T14:00:00.123Z", X: 1234.567, Y: -8901.234, Z: 0.5}
+
+	for _, format := range []PayloadFormat{PayloadFormatJSON, PayloadFormatProtobuf, PayloadFormatProtobufZstd} {
+		b.Run(string(format), func(b *testing.B) {
+			encoded, _ := encodeLocationPoint(format, loc)
+			b.ReportMetric(float64(len(encoded)), "bytes/entry")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := encodeLocationPoint(format, loc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONBaselineIsLargerThanProtobuf(t *testing.T) {
+	loc := LocationPoint{SessionKey: 9140, DriverNumber: 44, Date: "2024-05-12T14:00:00.123Z", X: 1234.567, Y: -8901.234, Z: 0.5}
+
+	jsonBytes, _ := json.Marshal(loc)
+	protoBytes := marshalLocationPoint(loc)
+
+	if len(protoBytes) >= len(jsonBytes) {
+		t.Errorf("expected protobuf encoding (%d bytes) to be smaller than JSON (%d bytes)", len(protoBytes), len(jsonBytes))
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -53,19 +54,30 @@ const (
 )
 
 var (
-	redisClient     *redis.Client
-	ctx             = context.Background()
-	lastFetchedTime string // Track last fetched timestamp to avoid duplicates
+	redisClient   *redis.Client
+	spatialIndex  *SpatialIndex
+	supplier      TelemetrySupplier
+	payloadFormat PayloadFormat
+	retryTimeout  time.Duration
+	ctx           = context.Background()
 )
 
 func main() {
 	// Load .env (optional - will use environment vars if not found)
 	_ = godotenv.Load()
 
+	backfill := flag.Bool("backfill", false, "re-fetch every interval of the session, ignoring any saved checkpoint")
+	live := flag.Bool("live", false, "only fetch the trailing (most recent) interval instead of catching up on history")
+	flag.Parse()
+
 	// Get config from environment
 	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
 	sessionKey := getEnv("SESSION_KEY", "9140")
-	pollInterval := getEnvInt("POLL_INTERVAL_MS", 1000)
+	fetchConcurrency := getEnvInt("FETCH_CONCURRENCY", defaultFetchConcurrency)
+	broadcastAddr := getEnv("BROADCAST_ADDR", "")
+	payloadFormat = parsePayloadFormat(getEnv("PAYLOAD_FORMAT", "json"))
+	log.Printf("Payload format: %s", payloadFormat)
+	retryTimeout = time.Duration(getEnvInt("RETRY_TIMEOUT_SEC", int(defaultRetryTimeout.Seconds()))) * time.Second
 
 	// Initialize Redis client
 	redisClient = redis.NewClient(&redis.Options{
@@ -78,34 +90,68 @@ func main() {
 	}
 	log.Printf("Connected to Redis at %s", redisAddr)
 
+	spatialIndex = NewSpatialIndex(redisClient)
+	supplier = NewTelemetrySupplier()
+
+	if broadcastAddr != "" {
+		maxMessageBytes := getEnvInt("WS_MAX_MESSAGE_BYTES", defaultMaxMessageBytes)
+		broadcastServer := NewBroadcastServer(redisClient, maxMessageBytes)
+		mux := http.NewServeMux()
+		broadcastServer.Routes(mux)
+		spatialIndex.Routes(mux)
+
+		go func() {
+			log.Printf("Starting broadcast server on %s", broadcastAddr)
+			if err := http.ListenAndServe(broadcastAddr, mux); err != nil {
+				log.Printf("Broadcast server stopped: %v", err)
+			}
+		}()
+	}
+
 	// Setup graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start polling loop
-	ticker := time.NewTicker(time.Duration(pollInterval) * time.Millisecond)
-	defer ticker.Stop()
-
 	log.Printf("Starting telemetry ingestion for session: %s", sessionKey)
-	log.Printf("Poll interval: %dms", pollInterval)
+	log.Printf("Fetch concurrency: %d", fetchConcurrency)
 
 	startEndTime := fetchTimes(sessionKey)
-
 	reqIntervals := generateTimeIntervals(startEndTime)
 
-	// Initial fetch
-	fetchAndPush(sessionKey, reqIntervals[0])
-
-	for i := 1; i < len(reqIntervals); i++ {
-		select {
-		case <-ticker.C:
-			fetchAndPush(sessionKey, reqIntervals[i])
-		case <-stop:
-			log.Println("Shutting down gracefully...")
-			redisClient.Close()
-			return
+	var toFetch []RaceTimes
+	switch {
+	case *live:
+		toFetch = reqIntervals[len(reqIntervals)-1:]
+	case *backfill:
+		toFetch = reqIntervals
+	default:
+		checkpoint, err := loadCheckpoint(sessionKey)
+		if err != nil {
+			log.Printf("Error loading checkpoint, fetching from the start: %v", err)
+			checkpoint = nil
 		}
+		toFetch = pendingIntervals(reqIntervals, checkpoint)
 	}
+
+	// runIntervalPool consumes the signal it stops on, so note it here before
+	// handing the pool its own stop channel.
+	poolStop := make(chan os.Signal, 1)
+	interrupted := make(chan struct{})
+	go func() {
+		sig := <-stop
+		close(interrupted)
+		poolStop <- sig
+	}()
+
+	runIntervalPool(sessionKey, toFetch, fetchConcurrency, poolStop)
+
+	select {
+	case <-interrupted:
+		log.Println("Shutting down gracefully...")
+	default:
+		log.Println("Finished ingesting all intervals")
+	}
+	redisClient.Close()
 }
 
 func generateTimeIntervals(times RaceTimes) []RaceTimes {
@@ -138,27 +184,40 @@ func generateTimeIntervals(times RaceTimes) []RaceTimes {
 	return result
 }
 
-func fetchAndPush(sessionKey string, times RaceTimes) {
+// fetchAndPush fetches and pushes one interval's locations and car data. It
+// returns the Redis stream ID of the last location point it persisted, and a
+// non-nil error if either fetch gave up after exhausting its retry budget —
+// callers must not checkpoint an interval that reports an error, since
+// "we fetched and got nothing" and "we never managed to fetch" need
+// different treatment on restart.
+func fetchAndPush(sessionKey string, times RaceTimes) (string, error) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
+	var lastLocationID string
+	var locErr, carErr error
 	go func() {
 		defer wg.Done()
-		locations := fetchLocations(sessionKey, times)
+		locations, lastID, err := supplier.FetchLocations(sessionKey, times)
+		lastLocationID = lastID
+		locErr = err
 		if len(locations) > 0 {
-			pushLocations(sessionKey, locations)
+			if err := spatialIndex.Upsert(ctx, sessionKey, locations); err != nil {
+				log.Printf("Error updating spatial index: %v", err)
+			}
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		carData := fetchCarData(sessionKey, times)
-		if len(carData) > 0 {
-			pushCarData(sessionKey, carData)
-		}
+		_, carErr = supplier.FetchCarData(sessionKey, times)
 	}()
 
 	wg.Wait()
+	if locErr != nil {
+		return lastLocationID, locErr
+	}
+	return lastLocationID, carErr
 }
 
 func fetchTimes(sessionKey string) RaceTimes {
@@ -172,7 +231,13 @@ func fetchTimes(sessionKey string) RaceTimes {
 	return raceTimes[0]
 }
 
-func fetchLocations(sessionKey string, times RaceTimes) []LocationPoint {
+// fetchLocations returns no points and a nil error for a window that was
+// genuinely fetched and simply had no points in it. A non-nil error means
+// the window was never actually retrieved, either because the retry budget
+// was exhausted or because the failure was not retryable (a gap marker is
+// pushed in that case) — callers must not treat the two the same way
+// when deciding whether an interval is done.
+func fetchLocations(sessionKey string, times RaceTimes) ([]LocationPoint, error) {
 	params := url.Values{}
 	params.Add("session_key", sessionKey)
 	params.Add("date>", times.DateStart)
@@ -183,16 +248,18 @@ func fetchLocations(sessionKey string, times RaceTimes) []LocationPoint {
 	log.Println(url)
 
 	var locations []LocationPoint
-	if err := fetchJSON(url, &locations); err != nil {
-		log.Printf("Error fetching locations: %v", err)
-		return nil
+	if err := fetchJSONWithRetry(url, &locations, retryTimeout); err != nil {
+		log.Printf("Error fetching locations, giving up on window %s-%s: %v", times.DateStart, times.DateEnd, err)
+		pushGapMarker(fmt.Sprintf("telemetry:location:%s", sessionKey), times, err)
+		return nil, err
 	}
 
 	log.Printf("Fetched %d location points", len(locations))
-	return locations
+	return locations, nil
 }
 
-func fetchCarData(sessionKey string, times RaceTimes) []CarData {
+// fetchCarData has the same nil-vs-error contract as fetchLocations.
+func fetchCarData(sessionKey string, times RaceTimes) ([]CarData, error) {
 	params := url.Values{}
 	params.Add("session_key", sessionKey)
 	params.Add("date>", times.DateStart)
@@ -202,13 +269,14 @@ func fetchCarData(sessionKey string, times RaceTimes) []CarData {
 	//url := fmt.Sprintf("%s?session_key=%s&date%%3E%s&date%%3C%s", baseCarDataURL, sessionKey, times.DateStart, times.DateEnd)
 
 	var carData []CarData
-	if err := fetchJSON(url, &carData); err != nil {
-		log.Printf("Error fetching car data: %v", err)
-		return nil
+	if err := fetchJSONWithRetry(url, &carData, retryTimeout); err != nil {
+		log.Printf("Error fetching car data, giving up on window %s-%s: %v", times.DateStart, times.DateEnd, err)
+		pushGapMarker(fmt.Sprintf("telemetry:cardata:%s", sessionKey), times, err)
+		return nil, err
 	}
 
 	log.Printf("Fetched %d car data points", len(carData))
-	return carData
+	return carData, nil
 }
 
 func fetchJSON(url string, target interface{}) error {
@@ -219,19 +287,27 @@ func fetchJSON(url string, target interface{}) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %s", resp.Status)
+		return &httpStatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp)}
 	}
 
 	return json.NewDecoder(resp.Body).Decode(target)
 }
 
-func pushLocations(sessionKey string, locations []LocationPoint) {
+// pushLocations writes locations to the session's Redis stream and returns
+// the ID of the last entry it successfully added, so callers can checkpoint
+// their progress.
+func pushLocations(sessionKey string, locations []LocationPoint) string {
 	streamKey := fmt.Sprintf("telemetry:location:%s", sessionKey)
 
+	var lastID string
 	for _, loc := range locations {
-		data, _ := json.Marshal(loc)
+		data, err := encodeLocationPoint(payloadFormat, loc)
+		if err != nil {
+			log.Printf("Error encoding location point: %v", err)
+			continue
+		}
 
-		err := redisClient.XAdd(ctx, &redis.XAddArgs{
+		id, err := redisClient.XAdd(ctx, &redis.XAddArgs{
 			Stream: streamKey,
 			Values: map[string]interface{}{
 				"driver_number": loc.DriverNumber,
@@ -239,27 +315,35 @@ func pushLocations(sessionKey string, locations []LocationPoint) {
 				"y":             loc.Y,
 				"z":             loc.Z,
 				"timestamp":     loc.Date,
+				"format":        string(payloadFormat),
 				"data":          data,
 			},
-		}).Err()
+		}).Result()
 
 		if err != nil {
 			log.Printf("Error pushing to Redis: %v", err)
+			continue
 		}
+		lastID = id
 	}
 
 	// Trim stream to prevent unbounded growth
 	redisClient.XTrimMaxLenApprox(ctx, streamKey, maxStreamLen, 0)
 	log.Printf("Pushed %d locations to %s", len(locations), streamKey)
+	return lastID
 }
 
 func pushCarData(sessionKey string, carData []CarData) {
 	streamKey := fmt.Sprintf("telemetry:cardata:%s", sessionKey)
 
 	for _, cd := range carData {
-		data, _ := json.Marshal(cd)
+		data, err := encodeCarData(payloadFormat, cd)
+		if err != nil {
+			log.Printf("Error encoding car data: %v", err)
+			continue
+		}
 
-		err := redisClient.XAdd(ctx, &redis.XAddArgs{
+		err = redisClient.XAdd(ctx, &redis.XAddArgs{
 			Stream: streamKey,
 			Values: map[string]interface{}{
 				"driver_number": cd.DriverNumber,
@@ -269,6 +353,7 @@ func pushCarData(sessionKey string, carData []CarData) {
 				"throttle":      cd.Throttle,
 				"brake":         cd.Brake,
 				"timestamp":     cd.Date,
+				"format":        string(payloadFormat),
 				"data":          data,
 			},
 		}).Err()
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRetryTimeout = 30 * time.Second
+	initialRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
+// httpStatusError carries the response status and any server-requested
+// Retry-After delay so callers can tell a transient failure (5xx, 429) from
+// one that will never succeed (404, bad request, ...).
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.StatusCode)
+}
+
+// parseRetryAfter reads the Retry-After header, supporting both the
+// delay-seconds and HTTP-date forms.
+func parseRetryAfter(resp *http.Response) time.Duration {
+	raw := resp.Header.Get("Retry-After")
+	if raw == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(raw); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// classifyRetry decides whether err is worth retrying and, if so, how long
+// to wait before the next attempt (0 meaning "use the caller's backoff").
+func classifyRetry(err error) (retryAfter time.Duration, retryable bool) {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500 {
+			return statusErr.RetryAfter, true
+		}
+		return 0, false
+	}
+
+	// Anything else (DNS failures, connection resets, timeouts, or a 200
+	// response whose body failed to decode) is retried too.
+	return 0, true
+}
+
+// fetchJSONWithRetry calls fetchJSON, retrying transient failures (5xx,
+// 429, network errors) with exponential backoff until retryTimeout has
+// elapsed since the first attempt. It aborts before sleeping past the
+// window rather than after, so callers get a clear timeout error instead of
+// one last attempt that overruns retryTimeout.
+func fetchJSONWithRetry(url string, target interface{}, retryTimeout time.Duration) error {
+	startTime := time.Now()
+	backoff := initialRetryBackoff
+
+	for {
+		err := fetchJSON(url, target)
+		if err == nil {
+			return nil
+		}
+
+		retryAfter, retryable := classifyRetry(err)
+		if !retryable {
+			return err
+		}
+
+		sleep := backoff
+		if retryAfter > 0 {
+			sleep = retryAfter
+		}
+
+		elapsed := time.Since(startTime)
+		if elapsed+sleep > retryTimeout {
+			return fmt.Errorf("giving up on %s after %v (retry timeout %v): %w", url, elapsed, retryTimeout, err)
+		}
+
+		log.Printf("Retrying %s in %v (elapsed %v): %v", url, sleep, elapsed, err)
+		time.Sleep(sleep)
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// pushGapMarker records that a fetch window was never retrieved, so
+// replayers can distinguish "no cars on track" from "ingestor was blind"
+// instead of the window simply being absent from the stream.
+func pushGapMarker(streamKey string, times RaceTimes, cause error) {
+	err := redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey,
+		Values: map[string]interface{}{
+			"gap":          true,
+			"window_start": times.DateStart,
+			"window_end":   times.DateEnd,
+			"reason":       cause.Error(),
+		},
+	}).Err()
+
+	if err != nil {
+		log.Printf("Error pushing gap marker to %s: %v", streamKey, err)
+	}
+}
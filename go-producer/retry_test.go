@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+	}{
+		{name: "429 is retryable", err: &httpStatusError{StatusCode: http.StatusTooManyRequests}, wantRetryable: true},
+		{name: "500 is retryable", err: &httpStatusError{StatusCode: http.StatusInternalServerError}, wantRetryable: true},
+		{name: "503 is retryable", err: &httpStatusError{StatusCode: http.StatusServiceUnavailable}, wantRetryable: true},
+		{name: "404 is not retryable", err: &httpStatusError{StatusCode: http.StatusNotFound}, wantRetryable: false},
+		{name: "400 is not retryable", err: &httpStatusError{StatusCode: http.StatusBadRequest}, wantRetryable: false},
+		{name: "network error is retryable", err: errors.New("dial tcp: connection refused"), wantRetryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, retryable := classifyRetry(tt.err)
+			if retryable != tt.wantRetryable {
+				t.Errorf("classifyRetry(%v) retryable = %v, want %v", tt.err, retryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestFetchJSONWithRetrySucceedsAfterTransientFailures(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"driver_number": 44}]`))
+	}))
+	defer server.Close()
+
+	var result []LocationPoint
+	if err := fetchJSONWithRetry(server.URL, &result, 5*time.Second); err != nil {
+		t.Fatalf("fetchJSONWithRetry() error = %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+	if len(result) != 1 || result[0].DriverNumber != 44 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestFetchJSONWithRetryGivesUpOnNonRetryableStatus(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var result []LocationPoint
+	err := fetchJSONWithRetry(server.URL, &result, 5*time.Second)
+	if err == nil {
+		t.Fatal("fetchJSONWithRetry() expected error for 404, got nil")
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt for a non-retryable status, got %d", attempts)
+	}
+}
+
+func TestFetchJSONWithRetryAbortsAfterTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var result []LocationPoint
+	start := time.Now()
+	err := fetchJSONWithRetry(server.URL, &result, 700*time.Millisecond)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("fetchJSONWithRetry() expected error after retry timeout, got nil")
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("fetchJSONWithRetry() took %v, expected it to abort close to the retry timeout", elapsed)
+	}
+}
+
+func TestParseRetryAfterSeconds(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+	if got := parseRetryAfter(resp); got != 2*time.Second {
+		t.Errorf("parseRetryAfter() = %v, want 2s", got)
+	}
+}
+
+func TestParseRetryAfterMissing(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if got := parseRetryAfter(resp); got != 0 {
+		t.Errorf("parseRetryAfter() = %v, want 0", got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// geoScale converts track XY, in meters, into synthetic lon/lat degrees so
+// Redis GEOADD/GEOSEARCH (which work in geodesic degrees) can index a flat
+// local coordinate system. It must equal meters-per-degree at the equator
+// (~111,320m) so that a distance between two stored points in degrees comes
+// back out of GEOSEARCH as the same distance in real track meters; a track
+// is small enough relative to that scale that the latitude-dependent
+// longitude shrinkage Redis doesn't account for is negligible.
+const geoScale = 111320.0
+
+// SpatialIndex keeps each driver's latest position in a Redis geo set keyed
+// by session, so dashboards can ask WITHIN/NEARBY questions without
+// re-scanning the telemetry:location stream.
+type SpatialIndex struct {
+	redisClient *redis.Client
+}
+
+// NewSpatialIndex builds a SpatialIndex backed by redisClient.
+func NewSpatialIndex(redisClient *redis.Client) *SpatialIndex {
+	return &SpatialIndex{redisClient: redisClient}
+}
+
+func geoKey(sessionKey string) string {
+	return fmt.Sprintf("telemetry:geo:%s", sessionKey)
+}
+
+func toLonLat(x, y float64) (lon, lat float64) {
+	return x / geoScale, y / geoScale
+}
+
+// Upsert records each driver's latest coordinate in the session's geo set,
+// overwriting any previous position for that driver.
+func (s *SpatialIndex) Upsert(ctx context.Context, sessionKey string, locations []LocationPoint) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	geoLocations := make([]*redis.GeoLocation, 0, len(locations))
+	for _, loc := range locations {
+		lon, lat := toLonLat(loc.X, loc.Y)
+		geoLocations = append(geoLocations, &redis.GeoLocation{
+			Name:      strconv.Itoa(loc.DriverNumber),
+			Longitude: lon,
+			Latitude:  lat,
+		})
+	}
+
+	return s.redisClient.GeoAdd(ctx, geoKey(sessionKey), geoLocations...).Err()
+}
+
+// Nearby returns the driver numbers within radiusMeters of the (x, y) point,
+// answering the "which cars are within N meters of car 44" question.
+func (s *SpatialIndex) Nearby(ctx context.Context, sessionKey string, x, y, radiusMeters float64) ([]int, error) {
+	lon, lat := toLonLat(x, y)
+
+	res, err := s.redisClient.GeoSearchLocation(ctx, geoKey(sessionKey), &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  lon,
+			Latitude:   lat,
+			Radius:     radiusMeters,
+			RadiusUnit: "m",
+		},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return driverNumbers(res)
+}
+
+// WithinBox returns the driver numbers whose current position falls inside
+// the axis-aligned box [minX,maxX] x [minY,maxY], answering "which cars are
+// in sector 2 right now".
+func (s *SpatialIndex) WithinBox(ctx context.Context, sessionKey string, minX, minY, maxX, maxY float64) ([]int, error) {
+	centerX, centerY := (minX+maxX)/2, (minY+maxY)/2
+	lon, lat := toLonLat(centerX, centerY)
+	// BoxWidth/BoxHeight are real distances (here, km), unlike
+	// Longitude/Latitude which are the synthetic degrees from toLonLat — so
+	// these come straight from the real meters, not through geoScale.
+	boxWidth := (maxX - minX) / 1000.0
+	boxHeight := (maxY - minY) / 1000.0
+
+	res, err := s.redisClient.GeoSearchLocation(ctx, geoKey(sessionKey), &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude: lon,
+			Latitude:  lat,
+			BoxWidth:  boxWidth,
+			BoxHeight: boxHeight,
+			BoxUnit:   "km",
+		},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return driverNumbers(res)
+}
+
+func driverNumbers(locations []redis.GeoLocation) ([]int, error) {
+	result := make([]int, 0, len(locations))
+	for _, loc := range locations {
+		n, err := strconv.Atoi(loc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected member in geo set: %q: %w", loc.Name, err)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// Routes registers the /nearby and /within/box query endpoints on mux.
+func (s *SpatialIndex) Routes(mux *http.ServeMux) {
+	mux.HandleFunc("/nearby", s.handleNearby)
+	mux.HandleFunc("/within/box", s.handleWithinBox)
+}
+
+func (s *SpatialIndex) handleNearby(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sessionKey := q.Get("session_key")
+	x, errX := strconv.ParseFloat(q.Get("x"), 64)
+	y, errY := strconv.ParseFloat(q.Get("y"), 64)
+	radius, errR := strconv.ParseFloat(q.Get("radius"), 64)
+	if sessionKey == "" || errX != nil || errY != nil || errR != nil {
+		http.Error(w, "session_key, x, y and radius are required", http.StatusBadRequest)
+		return
+	}
+
+	drivers, err := s.Nearby(r.Context(), sessionKey, x, y, radius)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeDriversJSON(w, drivers)
+}
+
+func (s *SpatialIndex) handleWithinBox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sessionKey := q.Get("session_key")
+	minX, errMinX := strconv.ParseFloat(q.Get("min_x"), 64)
+	minY, errMinY := strconv.ParseFloat(q.Get("min_y"), 64)
+	maxX, errMaxX := strconv.ParseFloat(q.Get("max_x"), 64)
+	maxY, errMaxY := strconv.ParseFloat(q.Get("max_y"), 64)
+	if sessionKey == "" || errMinX != nil || errMinY != nil || errMaxX != nil || errMaxY != nil {
+		http.Error(w, "session_key, min_x, min_y, max_x and max_y are required", http.StatusBadRequest)
+		return
+	}
+
+	drivers, err := s.WithinBox(r.Context(), sessionKey, minX, minY, maxX, maxY)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeDriversJSON(w, drivers)
+}
+
+func writeDriversJSON(w http.ResponseWriter, drivers []int) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Drivers []int `json:"drivers"`
+	}{Drivers: drivers}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
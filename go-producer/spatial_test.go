@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGeoKey(t *testing.T) {
+	if got := geoKey("9140"); got != "telemetry:geo:9140" {
+		t.Errorf("geoKey(%q) = %q, want %q", "9140", got, "telemetry:geo:9140")
+	}
+}
+
+func TestToLonLat(t *testing.T) {
+	lon, lat := toLonLat(1500, -850)
+	if math.Abs(lon-1500/geoScale) > 1e-9 {
+		t.Errorf("toLonLat() lon = %v, want %v", lon, 1500/geoScale)
+	}
+	if math.Abs(lat-(-850/geoScale)) > 1e-9 {
+		t.Errorf("toLonLat() lat = %v, want %v", lat, -850/geoScale)
+	}
+}
+
+// TestToLonLatPreservesRealDistance verifies the actual invariant the
+// /nearby and /within/box endpoints depend on: the geodesic distance Redis
+// computes between two stored points must come back out in meters close to
+// their real track separation, not off by the geoScale factor.
+func TestToLonLatPreservesRealDistance(t *testing.T) {
+	tests := []struct {
+		name       string
+		x1, y1     float64
+		x2, y2     float64
+		wantMeters float64
+	}{
+		{name: "50m apart on x axis", x1: 0, y1: 0, x2: 50, y2: 0, wantMeters: 50},
+		{name: "1000m apart diagonally", x1: 0, y1: 0, x2: 600, y2: 800, wantMeters: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lon1, lat1 := toLonLat(tt.x1, tt.y1)
+			lon2, lat2 := toLonLat(tt.x2, tt.y2)
+			got := haversineMeters(lon1, lat1, lon2, lat2)
+
+			if math.Abs(got-tt.wantMeters) > tt.wantMeters*0.01 {
+				t.Errorf("geodesic distance = %.3fm, want ~%.3fm (real track separation)", got, tt.wantMeters)
+			}
+		})
+	}
+}
+
+// haversineMeters computes the geodesic distance between two lon/lat
+// points, the same quantity GEOSEARCH filters Radius/BoxWidth/BoxHeight
+// against.
+func haversineMeters(lon1, lat1, lon2, lat2 float64) float64 {
+	const earthRadiusMeters = 6371000.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusMeters * c
+}
+
+func TestDriverNumbers(t *testing.T) {
+	t.Run("valid members", func(t *testing.T) {
+		locations := []redis.GeoLocation{{Name: "1"}, {Name: "44"}}
+		got, err := driverNumbers(locations)
+		if err != nil {
+			t.Fatalf("driverNumbers() error = %v", err)
+		}
+		if len(got) != 2 || got[0] != 1 || got[1] != 44 {
+			t.Errorf("driverNumbers() = %v, want [1 44]", got)
+		}
+	})
+
+	t.Run("non-numeric member", func(t *testing.T) {
+		locations := []redis.GeoLocation{{Name: "not-a-number"}}
+		_, err := driverNumbers(locations)
+		if err == nil {
+			t.Error("driverNumbers() expected error for non-numeric member, got nil")
+		}
+	})
+}
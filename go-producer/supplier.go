@@ -0,0 +1,181 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCacheCapacity bounds how many (driver_number, date) tuples the top
+// dedupe layer remembers before evicting the oldest.
+const lruCacheCapacity = 20000
+
+// TelemetrySupplier fetches a window of telemetry for a session. Layers are
+// composed top to bottom: a Redis stream layer wraps an in-process LRU
+// dedupe layer, which wraps the OpenF1 HTTP source. The LRU layer sits
+// below Redis so the points it filters never reach XADD; swapping the
+// bottom or middle layer (a different backend, a different cache) doesn't
+// require touching callers.
+type TelemetrySupplier interface {
+	// FetchLocations returns the location points for times, along with the
+	// Redis stream ID of the last point this call persisted (empty if none
+	// were persisted). The ID is returned directly rather than tracked in
+	// shared state because callers fetch many intervals for the same
+	// session concurrently, and a session-keyed "last ID" would race across
+	// them. A non-nil error means the window was never actually retrieved
+	// (the retry budget was exhausted or the failure was not retryable), as
+	// opposed to a nil error with zero
+	// points, which means the window was fetched and genuinely empty.
+	FetchLocations(sessionKey string, times RaceTimes) (locations []LocationPoint, lastLocationID string, err error)
+	FetchCarData(sessionKey string, times RaceTimes) ([]CarData, error)
+}
+
+// NewTelemetrySupplier builds the default Redis -> LRU -> OpenF1 layering.
+func NewTelemetrySupplier() TelemetrySupplier {
+	source := &openF1Supplier{}
+	lruLayer := &lruSupplier{
+		next:     source,
+		locCache: newLRUCache(lruCacheCapacity),
+		carCache: newLRUCache(lruCacheCapacity),
+	}
+	return &redisSupplier{
+		next:          lruLayer,
+		pushLocations: pushLocations,
+		pushCarData:   pushCarData,
+	}
+}
+
+// openF1Supplier is the bottom layer: it fetches directly from OpenF1.
+type openF1Supplier struct{}
+
+func (openF1Supplier) FetchLocations(sessionKey string, times RaceTimes) ([]LocationPoint, string, error) {
+	locations, err := fetchLocations(sessionKey, times)
+	return locations, "", err
+}
+
+func (openF1Supplier) FetchCarData(sessionKey string, times RaceTimes) ([]CarData, error) {
+	return fetchCarData(sessionKey, times)
+}
+
+// redisSupplier is the top layer: it pulls already-deduped points from next
+// and persists them into the Redis streams via XADD/XTRIM. pushLocations and
+// pushCarData are fields rather than direct calls to the package functions
+// of the same name so tests can assert on exactly what reaches the push
+// without a live Redis connection.
+type redisSupplier struct {
+	next          TelemetrySupplier
+	pushLocations func(sessionKey string, locations []LocationPoint) string
+	pushCarData   func(sessionKey string, carData []CarData)
+}
+
+func (s *redisSupplier) FetchLocations(sessionKey string, times RaceTimes) ([]LocationPoint, string, error) {
+	locations, _, err := s.next.FetchLocations(sessionKey, times)
+	if err != nil {
+		return locations, "", err
+	}
+	var lastID string
+	if len(locations) > 0 {
+		lastID = s.pushLocations(sessionKey, locations)
+	}
+	return locations, lastID, nil
+}
+
+func (s *redisSupplier) FetchCarData(sessionKey string, times RaceTimes) ([]CarData, error) {
+	carData, err := s.next.FetchCarData(sessionKey, times)
+	if err != nil {
+		return carData, err
+	}
+	if len(carData) > 0 {
+		s.pushCarData(sessionKey, carData)
+	}
+	return carData, nil
+}
+
+// lruSupplier is the middle layer: it filters out (driver_number, date)
+// tuples already seen across polling ticks before its caller (redisSupplier)
+// ever pushes them, which is what the naive date>/date< window queries need
+// at boundary seconds to stop producing duplicate points in the stream.
+type lruSupplier struct {
+	next     TelemetrySupplier
+	locCache *lruCache
+	carCache *lruCache
+}
+
+func (s *lruSupplier) FetchLocations(sessionKey string, times RaceTimes) ([]LocationPoint, string, error) {
+	locations, lastID, err := s.next.FetchLocations(sessionKey, times)
+	if err != nil {
+		return locations, lastID, err
+	}
+
+	deduped := make([]LocationPoint, 0, len(locations))
+	for _, loc := range locations {
+		key := seenKey{sessionKey: sessionKey, driverNumber: loc.DriverNumber, date: loc.Date}
+		if s.locCache.seenOrAdd(key) {
+			continue
+		}
+		deduped = append(deduped, loc)
+	}
+	return deduped, lastID, nil
+}
+
+func (s *lruSupplier) FetchCarData(sessionKey string, times RaceTimes) ([]CarData, error) {
+	carData, err := s.next.FetchCarData(sessionKey, times)
+	if err != nil {
+		return carData, err
+	}
+
+	deduped := make([]CarData, 0, len(carData))
+	for _, cd := range carData {
+		key := seenKey{sessionKey: sessionKey, driverNumber: cd.DriverNumber, date: cd.Date}
+		if s.carCache.seenOrAdd(key) {
+			continue
+		}
+		deduped = append(deduped, cd)
+	}
+	return deduped, nil
+}
+
+// seenKey identifies a single telemetry sample for dedupe purposes.
+type seenKey struct {
+	sessionKey   string
+	driverNumber int
+	date         string
+}
+
+// lruCache is a fixed-capacity least-recently-used set of seenKeys.
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[seenKey]*list.Element
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[seenKey]*list.Element),
+	}
+}
+
+// seenOrAdd reports whether key was already present, and if not, adds it.
+func (c *lruCache) seenOrAdd(key seenKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return true
+	}
+
+	elem := c.order.PushFront(key)
+	c.items[key] = elem
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(seenKey))
+		}
+	}
+	return false
+}
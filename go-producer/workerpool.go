@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+const defaultFetchConcurrency = 4
+
+// checkpointKey is the Redis hash that maps an interval's start time to the
+// last location stream ID ingested for it, so a restarted process can tell
+// which of reqIntervals are already done.
+func checkpointKey(sessionKey string) string {
+	return fmt.Sprintf("ingest:checkpoint:%s", sessionKey)
+}
+
+// loadCheckpoint returns the interval-start -> last-XADD-ID map persisted
+// for sessionKey, or an empty map if nothing has been ingested yet.
+func loadCheckpoint(sessionKey string) (map[string]string, error) {
+	return redisClient.HGetAll(ctx, checkpointKey(sessionKey)).Result()
+}
+
+// saveCheckpoint records that times has been ingested through lastID, so a
+// restart resumes after it instead of re-fetching the whole session.
+func saveCheckpoint(sessionKey string, times RaceTimes, lastID string) {
+	if lastID == "" {
+		lastID = "done" // the window was fetched but produced no points
+	}
+	if err := redisClient.HSet(ctx, checkpointKey(sessionKey), times.DateStart, lastID).Err(); err != nil {
+		log.Printf("Error saving checkpoint for %s: %v", times.DateStart, err)
+	}
+}
+
+// pendingIntervals drops any interval already recorded in checkpoint, so a
+// resumed run only re-fetches unfinished windows.
+func pendingIntervals(intervals []RaceTimes, checkpoint map[string]string) []RaceTimes {
+	pending := make([]RaceTimes, 0, len(intervals))
+	for _, interval := range intervals {
+		if _, done := checkpoint[interval.DateStart]; done {
+			continue
+		}
+		pending = append(pending, interval)
+	}
+	return pending
+}
+
+// runIntervalPool fans intervals out to a bounded pool of concurrency
+// workers, each fetching and pushing one interval at a time and
+// checkpointing it on completion. It returns once every interval has been
+// dispatched and processed, or stop fires.
+func runIntervalPool(sessionKey string, intervals []RaceTimes, concurrency int, stop <-chan os.Signal) {
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+
+	jobs := make(chan RaceTimes)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for times := range jobs {
+				processInterval(sessionKey, times)
+			}
+		}()
+	}
+
+dispatch:
+	for _, times := range intervals {
+		select {
+		case jobs <- times:
+		case <-stop:
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// processInterval fetches and pushes a single interval and checkpoints the
+// session's progress against it. An interval whose fetch gave up after
+// exhausting its retry budget is left uncheckpointed, so a process restart
+// retries it instead of treating the outage as done.
+func processInterval(sessionKey string, times RaceTimes) {
+	lastLocationID, err := fetchAndPush(sessionKey, times)
+	if err != nil {
+		log.Printf("Not checkpointing %s: %v", times.DateStart, err)
+		return
+	}
+	saveCheckpoint(sessionKey, times, lastLocationID)
+}
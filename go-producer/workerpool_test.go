@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestCheckpointKey(t *testing.T) {
+	if got := checkpointKey("9140"); got != "ingest:checkpoint:9140" {
+		t.Errorf("checkpointKey(%q) = %q, want %q", "9140", got, "ingest:checkpoint:9140")
+	}
+}
+
+func TestPendingIntervals(t *testing.T) {
+	intervals := []RaceTimes{
+		{DateStart: "t0", DateEnd: "t1"},
+		{DateStart: "t1", DateEnd: "t2"},
+		{DateStart: "t2", DateEnd: "t3"},
+	}
+
+	t.Run("nil checkpoint keeps everything", func(t *testing.T) {
+		got := pendingIntervals(intervals, nil)
+		if len(got) != len(intervals) {
+			t.Errorf("pendingIntervals() = %d intervals, want %d", len(got), len(intervals))
+		}
+	})
+
+	t.Run("drops completed intervals", func(t *testing.T) {
+		checkpoint := map[string]string{"t0": "1234-0", "t1": "done"}
+		got := pendingIntervals(intervals, checkpoint)
+		if len(got) != 1 || got[0].DateStart != "t2" {
+			t.Errorf("pendingIntervals() = %+v, want only the t2 interval", got)
+		}
+	})
+}